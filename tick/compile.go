@@ -0,0 +1,352 @@
+package tick
+
+import (
+	"fmt"
+	"math"
+)
+
+// Opcode identifies a single bytecode instruction understood by Program.Eval.
+type Opcode int
+
+const (
+	// OpPushConst pushes Instruction.Operand verbatim onto the stack.
+	OpPushConst Opcode = iota
+	// OpLoadVar pushes vars[Instruction.Operand.(int)] onto the stack,
+	// resolving it from the Vars slice passed to Program.Eval.
+	OpLoadVar
+	// OpNeg/OpNot implement the unary '-' and '!' operators.
+	OpNeg
+	OpNot
+	// OpBinary pops two operands and applies the binary operator stored in
+	// Instruction.Operand.(tokenType), using the same dispatch rules as
+	// StatefulExpr.evalBinary.
+	OpBinary
+	// Type-specialized fast paths for operand types known at compile time,
+	// avoiding the interface type switch OpBinary has to perform.
+	OpAddFF
+	OpSubFF
+	OpMulFF
+	OpDivFF
+	OpAddII
+	OpSubII
+	OpMulII
+	OpDivII
+	OpLtFF
+	OpGtFF
+	// OpCall pops len(args) operands, calls the named function and pushes
+	// its result.
+	OpCall
+	// OpJumpIfFalse pops a bool and, if false, jumps to Instruction.Operand.(int).
+	OpJumpIfFalse
+	// OpJump unconditionally jumps to Instruction.Operand.(int).
+	OpJump
+)
+
+// Instruction is a single flat bytecode op with its operand, if any.
+type Instruction struct {
+	Op      Opcode
+	Operand interface{}
+}
+
+type callOperand struct {
+	Func string
+	Argc int
+}
+
+// Program is a compiled, flattened form of a tick expression AST.
+// It avoids re-walking the tree on every evaluation, which matters since
+// expressions are evaluated once per point. Each evaluation still allocates
+// a fresh operand stack.
+type Program struct {
+	instrs   []Instruction
+	varNames []string
+	varIndex map[string]int
+
+	// Strict controls OpBinary's int64/float64 coercion and Null handling,
+	// matching StatefulExpr.Strict. It defaults to false (lenient), the
+	// same default StatefulExpr uses. To get Null propagation for a
+	// missing field, put a tick.Null{} in that variable's slot in the
+	// vars slice passed to EvalBool/EvalNum -- Program has no Vars map of
+	// its own to tell "missing" apart from "present but nil".
+	Strict bool
+}
+
+// Compile lowers n into a flat instruction program. The returned Program
+// can be evaluated repeatedly via EvalBool/EvalNum without re-walking n.
+func Compile(n Node) (*Program, error) {
+	p := &Program{
+		varIndex: make(map[string]int),
+	}
+	if err := p.compile(n); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Program) varSlot(name string) int {
+	if idx, ok := p.varIndex[name]; ok {
+		return idx
+	}
+	idx := len(p.varNames)
+	p.varIndex[name] = idx
+	p.varNames = append(p.varNames, name)
+	return idx
+}
+
+func (p *Program) emit(op Opcode, operand interface{}) int {
+	p.instrs = append(p.instrs, Instruction{Op: op, Operand: operand})
+	return len(p.instrs) - 1
+}
+
+func (p *Program) compile(n Node) error {
+	switch node := n.(type) {
+	case *BoolNode:
+		p.emit(OpPushConst, node.Bool)
+	case *NumberNode:
+		if node.IsInt {
+			p.emit(OpPushConst, node.Int64)
+		} else {
+			p.emit(OpPushConst, node.Float64)
+		}
+	case *DurationNode:
+		p.emit(OpPushConst, node.Dur)
+	case *StringNode:
+		p.emit(OpPushConst, node.Literal)
+	case *RegexNode:
+		p.emit(OpPushConst, node.Regex)
+	case *ReferenceNode:
+		p.emit(OpLoadVar, p.varSlot(node.Reference))
+	case *UnaryNode:
+		if err := p.compile(node.Node); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case tokenMinus:
+			p.emit(OpNeg, nil)
+		case tokenNot:
+			p.emit(OpNot, nil)
+		default:
+			return fmt.Errorf("invalid unary operator %v", node.Operator)
+		}
+	case *BinaryNode:
+		if err := p.compile(node.Left); err != nil {
+			return err
+		}
+		if err := p.compile(node.Right); err != nil {
+			return err
+		}
+		if op, ok := specializedOp(node.Operator, node.Left, node.Right); ok {
+			p.emit(op, nil)
+		} else {
+			p.emit(OpBinary, node.Operator)
+		}
+	case *FunctionNode:
+		for _, arg := range node.Args {
+			if err := p.compile(arg); err != nil {
+				return err
+			}
+		}
+		p.emit(OpCall, callOperand{Func: node.Func, Argc: len(node.Args)})
+	case *ConditionalNode:
+		if err := p.compile(node.CondExpr); err != nil {
+			return err
+		}
+		jumpToFalse := p.emit(OpJumpIfFalse, nil)
+		if err := p.compile(node.TrueExpr); err != nil {
+			return err
+		}
+		jumpToEnd := p.emit(OpJump, nil)
+		p.instrs[jumpToFalse].Operand = len(p.instrs)
+		if err := p.compile(node.FalseExpr); err != nil {
+			return err
+		}
+		p.instrs[jumpToEnd].Operand = len(p.instrs)
+	default:
+		p.emit(OpPushConst, node)
+	}
+	return nil
+}
+
+// specializedOp picks a type-specialized opcode when both operands of a
+// binary node are literal numbers of the same kind, so the hot loop can
+// skip the interface type switch OpBinary otherwise performs.
+//
+// This only fires for two-literal subtrees, which Fold (typecheck.go)
+// already collapses into a single constant before compilation normally
+// sees them. A BinaryNode with a *ReferenceNode operand -- the case that
+// actually matters for per-point evaluation against real tag/field maps,
+// e.g. `cpu_usage * 100` -- still falls through to the generic OpBinary
+// case below. Specializing that case needs each reference's type known at
+// compile time (e.g. from a schema passed alongside n), which Compile
+// doesn't currently accept.
+func specializedOp(op tokenType, left, right Node) (Opcode, bool) {
+	ln, lok := left.(*NumberNode)
+	rn, rok := right.(*NumberNode)
+	if !lok || !rok || ln.IsInt != rn.IsInt {
+		return 0, false
+	}
+	if ln.IsInt {
+		switch op {
+		case tokenPlus:
+			return OpAddII, true
+		case tokenMinus:
+			return OpSubII, true
+		case tokenMult:
+			return OpMulII, true
+		case tokenDiv:
+			return OpDivII, true
+		}
+		return 0, false
+	}
+	switch op {
+	case tokenPlus:
+		return OpAddFF, true
+	case tokenMinus:
+		return OpSubFF, true
+	case tokenMult:
+		return OpMulFF, true
+	case tokenDiv:
+		return OpDivFF, true
+	case tokenLess:
+		return OpLtFF, true
+	case tokenGreater:
+		return OpGtFF, true
+	}
+	return 0, false
+}
+
+// EvalBool runs the program against vars and returns the resulting bool.
+// vars must be indexed the same way as Program.VarNames. See Program.Strict
+// for how mixed int64/float64 operands and Null are handled.
+func (p *Program) EvalBool(vars []interface{}, funcs Funcs) (bool, error) {
+	v, err := p.run(vars, funcs)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned unexpected type %T", v)
+	}
+	return b, nil
+}
+
+// EvalNum runs the program against vars and returns the resulting float64.
+func (p *Program) EvalNum(vars []interface{}, funcs Funcs) (float64, error) {
+	v, err := p.run(vars, funcs)
+	if err != nil {
+		return math.NaN(), err
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int64:
+		return float64(n), nil
+	default:
+		return math.NaN(), fmt.Errorf("expression returned unexpected type %T", v)
+	}
+}
+
+// VarNames returns the variable names referenced by the program, in the
+// order their slot indices were assigned. Callers use this to build the
+// vars slice passed to EvalBool/EvalNum from a Vars map.
+func (p *Program) VarNames() []string {
+	return p.varNames
+}
+
+func (p *Program) run(vars []interface{}, funcs Funcs) (interface{}, error) {
+	stck := &stack{}
+	for pc := 0; pc < len(p.instrs); pc++ {
+		instr := p.instrs[pc]
+		switch instr.Op {
+		case OpPushConst:
+			stck.Push(instr.Operand)
+		case OpLoadVar:
+			stck.Push(vars[instr.Operand.(int)])
+		case OpNeg:
+			switch n := stck.Pop().(type) {
+			case float64:
+				stck.Push(-1 * n)
+			case int64:
+				stck.Push(-1 * n)
+			default:
+				return nil, fmt.Errorf("invalid arugument to '-' %v", n)
+			}
+		case OpNot:
+			b, ok := stck.Pop().(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid arugument to '!'")
+			}
+			stck.Push(!b)
+		case OpAddFF:
+			r, l := stck.Pop().(float64), stck.Pop().(float64)
+			stck.Push(l + r)
+		case OpSubFF:
+			r, l := stck.Pop().(float64), stck.Pop().(float64)
+			stck.Push(l - r)
+		case OpMulFF:
+			r, l := stck.Pop().(float64), stck.Pop().(float64)
+			stck.Push(l * r)
+		case OpDivFF:
+			r, l := stck.Pop().(float64), stck.Pop().(float64)
+			stck.Push(l / r)
+		case OpAddII:
+			r, l := stck.Pop().(int64), stck.Pop().(int64)
+			stck.Push(l + r)
+		case OpSubII:
+			r, l := stck.Pop().(int64), stck.Pop().(int64)
+			stck.Push(l - r)
+		case OpMulII:
+			r, l := stck.Pop().(int64), stck.Pop().(int64)
+			stck.Push(l * r)
+		case OpDivII:
+			r, l := stck.Pop().(int64), stck.Pop().(int64)
+			stck.Push(l / r)
+		case OpLtFF:
+			r, l := stck.Pop().(float64), stck.Pop().(float64)
+			stck.Push(l < r)
+		case OpGtFF:
+			r, l := stck.Pop().(float64), stck.Pop().(float64)
+			stck.Push(l > r)
+		case OpBinary:
+			r := stck.Pop()
+			l := stck.Pop()
+			v, err := evalBinaryValues(instr.Operand.(tokenType), l, r, p.Strict)
+			if err != nil {
+				return nil, err
+			}
+			stck.Push(v)
+		case OpCall:
+			co := instr.Operand.(callOperand)
+			args := make([]interface{}, co.Argc)
+			for i := co.Argc - 1; i >= 0; i-- {
+				args[i] = stck.Pop()
+			}
+			f := funcs[co.Func]
+			if f == nil {
+				return nil, fmt.Errorf("undefined function %s", co.Func)
+			}
+			ret, err := f.Call(args...)
+			if err != nil {
+				return nil, fmt.Errorf("error calling %s: %s", co.Func, err)
+			}
+			stck.Push(ret)
+		case OpJumpIfFalse:
+			cond := stck.Pop()
+			b, ok := cond.(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid conditional expression: condition must evaluate to bool but got %T", cond)
+			}
+			if !b {
+				pc = instr.Operand.(int) - 1
+			}
+		case OpJump:
+			pc = instr.Operand.(int) - 1
+		default:
+			return nil, fmt.Errorf("unknown opcode %v", instr.Op)
+		}
+	}
+	if stck.Len() != 1 {
+		return nil, ErrInvalidExpr
+	}
+	return stck.Pop(), nil
+}
@@ -0,0 +1,154 @@
+package tick
+
+import (
+	"testing"
+)
+
+// exprUnderTest builds `(cpu_usage * 100) > threshold`, used by both the
+// parity checks and the benchmarks below.
+func exprUnderTest() Node {
+	return &BinaryNode{
+		Operator: tokenGreater,
+		Left: &BinaryNode{
+			Operator: tokenMult,
+			Left:     &ReferenceNode{Reference: "cpu_usage"},
+			Right:    numF(100),
+		},
+		Right: &ReferenceNode{Reference: "threshold"},
+	}
+}
+
+func TestCompileMatchesTreeWalk(t *testing.T) {
+	n := exprUnderTest()
+	se := NewStatefulExpr(n)
+
+	prog, err := Compile(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []Vars{
+		{"cpu_usage": 0.9, "threshold": 80.0},
+		{"cpu_usage": 0.5, "threshold": 80.0},
+	}
+	for _, vars := range cases {
+		want, err := se.EvalBool(vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		progVars := make([]interface{}, len(prog.VarNames()))
+		for i, name := range prog.VarNames() {
+			progVars[i] = vars[name]
+		}
+		got, err := prog.EvalBool(progVars, se.Funcs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("vars=%v: tree-walk=%v bytecode=%v", vars, want, got)
+		}
+	}
+}
+
+func TestCompileConditionalJumps(t *testing.T) {
+	n := &ConditionalNode{
+		CondExpr:  &BinaryNode{Operator: tokenGreater, Left: &ReferenceNode{Reference: "x"}, Right: num(0)},
+		TrueExpr:  &StringNode{Literal: "positive"},
+		FalseExpr: &StringNode{Literal: "non-positive"},
+	}
+	prog, err := Compile(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := prog.varIndex["x"]
+
+	for _, c := range []struct {
+		x    int64
+		want string
+	}{{1, "positive"}, {-1, "non-positive"}, {0, "non-positive"}} {
+		vars := make([]interface{}, len(prog.VarNames()))
+		vars[idx] = c.x
+		v, err := prog.run(vars, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != c.want {
+			t.Errorf("x=%d: got %v, want %v", c.x, v, c.want)
+		}
+	}
+}
+
+func TestCompileSpecializesLiteralMath(t *testing.T) {
+	// Compile doesn't fold, so two float literals still reach specializedOp
+	// even though Fold would have collapsed them first in practice.
+	n := &BinaryNode{Operator: tokenPlus, Left: numF(1), Right: numF(2)}
+	prog, err := Compile(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotOp Opcode
+	for _, instr := range prog.instrs {
+		if instr.Op == OpAddFF {
+			gotOp = instr.Op
+		}
+	}
+	if gotOp != OpAddFF {
+		t.Fatalf("expected OpAddFF to be emitted for two float literals, instrs=%v", prog.instrs)
+	}
+	got, err := prog.EvalNum(nil, nil)
+	if err != nil || got != 3 {
+		t.Fatalf("got %v, %v, want 3, nil", got, err)
+	}
+}
+
+func TestProgramStrict(t *testing.T) {
+	n := &BinaryNode{Operator: tokenPlus, Left: num(1), Right: numF(2.5)}
+	prog, err := Compile(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := prog.EvalNum(nil, nil); err != nil {
+		t.Fatalf("lenient (default) program should coerce, got %v", err)
+	}
+
+	prog.Strict = true
+	if _, err := prog.EvalNum(nil, nil); err == nil {
+		t.Fatal("strict program should reject mixed int/float math")
+	}
+}
+
+func benchVars() Vars {
+	return Vars{"cpu_usage": 0.92, "threshold": 80.0}
+}
+
+func BenchmarkTreeWalk(b *testing.B) {
+	se := NewStatefulExpr(exprUnderTest())
+	vars := benchVars()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := se.EvalBool(vars); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBytecode(b *testing.B) {
+	n := exprUnderTest()
+	se := NewStatefulExpr(n)
+	prog, err := Compile(n)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vars := benchVars()
+	progVars := make([]interface{}, len(prog.VarNames()))
+	for i, name := range prog.VarNames() {
+		progVars[i] = vars[name]
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := prog.EvalBool(progVars, se.Funcs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package tick
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Func is a callable from within a tick expression, either stateless (e.g.
+// math.Abs) or stateful (e.g. a moving average that must Reset between
+// evaluation runs).
+type Func interface {
+	// Call invokes the function with already-evaluated arguments.
+	Call(args ...interface{}) (interface{}, error)
+	// Reset clears any internal state accumulated by previous calls.
+	Reset()
+}
+
+// Funcs is the set of functions available to a StatefulExpr, keyed by the
+// name used to call them from a tick expression.
+type Funcs map[string]Func
+
+// FuncSignature describes a Func's expected argument types and return type
+// so TypeCheck can validate a call site without invoking the function.
+// ArgTypes holds exactly one entry per expected argument, and TypeCheck
+// rejects a call whose argument count doesn't match len(ArgTypes) -- a
+// zero-argument func (e.g. now) leaves ArgTypes empty for that reason, not
+// because it's variadic; this package has no variadic-arity support.
+type FuncSignature struct {
+	ArgTypes   []Type
+	ReturnType Type
+}
+
+var (
+	globalFuncsMu        sync.RWMutex
+	globalFuncFactories  = map[string]func() Func{}
+	globalFuncSignatures = map[string]FuncSignature{}
+)
+
+// RegisterFunc makes newFunc available, under name, to every StatefulExpr
+// built afterwards via NewFunctions. Operators use this to add
+// domain-specific functions to .eval()/.where() without patching this
+// package. sig is used by TypeCheck to validate calls to name ahead of
+// evaluation.
+//
+// newFunc is a factory, not a shared value: NewFunctions calls it once per
+// StatefulExpr so each gets its own Func instance. A stateful Func (e.g. a
+// moving average that accumulates between calls) would otherwise be shared
+// by every task in the process, and Reset on one StatefulExpr would wipe
+// state out from under every other concurrent user of it.
+func RegisterFunc(name string, newFunc func() Func, sig FuncSignature) {
+	globalFuncsMu.Lock()
+	defer globalFuncsMu.Unlock()
+	globalFuncFactories[name] = newFunc
+	globalFuncSignatures[name] = sig
+}
+
+// RegisterFunc overrides, or adds, a function by name for this StatefulExpr
+// only, leaving the global registry untouched. Since fn is scoped to a
+// single StatefulExpr, there's no sharing concern and a concrete instance
+// is taken directly rather than a factory.
+func (s *StatefulExpr) RegisterFunc(name string, fn Func) {
+	s.Funcs[name] = fn
+}
+
+// NewFunctions returns the default set of functions: the builtin library
+// (stateless, safe to share) plus a fresh instance of every function added
+// via the package-level RegisterFunc.
+func NewFunctions() Funcs {
+	globalFuncsMu.RLock()
+	defer globalFuncsMu.RUnlock()
+	fns := make(Funcs, len(builtinFuncs)+len(globalFuncFactories))
+	for name, fn := range builtinFuncs {
+		fns[name] = fn
+	}
+	for name, newFunc := range globalFuncFactories {
+		fns[name] = newFunc()
+	}
+	return fns
+}
+
+// funcSignature returns the registered signature for name, checking
+// builtins before functions registered via RegisterFunc.
+func funcSignature(name string) (FuncSignature, bool) {
+	if sig, ok := builtinFuncSignatures[name]; ok {
+		return sig, true
+	}
+	globalFuncsMu.RLock()
+	defer globalFuncsMu.RUnlock()
+	sig, ok := globalFuncSignatures[name]
+	return sig, ok
+}
+
+// statelessFunc adapts a plain function to the Func interface for builtins
+// that carry no state between calls.
+type statelessFunc func(args ...interface{}) (interface{}, error)
+
+func (f statelessFunc) Call(args ...interface{}) (interface{}, error) { return f(args...) }
+func (f statelessFunc) Reset()                                        {}
+
+func arityError(name string, want, got int) error {
+	return fmt.Errorf("%s expects %d argument(s), got %d", name, want, got)
+}
+
+func argString(name string, args []interface{}, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s argument %d must be a string, got %T", name, i, args[i])
+	}
+	return s, nil
+}
+
+func argFloat(name string, args []interface{}, i int) (float64, error) {
+	switch n := args[i].(type) {
+	case float64:
+		return n, nil
+	case int64:
+		return float64(n), nil
+	default:
+		return 0, fmt.Errorf("%s argument %d must be numeric, got %T", name, i, args[i])
+	}
+}
+
+func argInt(name string, args []interface{}, i int) (int64, error) {
+	switch n := args[i].(type) {
+	case int64:
+		return n, nil
+	case float64:
+		return int64(n), nil
+	default:
+		return 0, fmt.Errorf("%s argument %d must be numeric, got %T", name, i, args[i])
+	}
+}
+
+var builtinFuncs = Funcs{
+	// string functions
+	"contains": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("contains", 2, len(args))
+		}
+		s, err := argString("contains", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		substr, err := argString("contains", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(s, substr), nil
+	}),
+	"startsWith": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("startsWith", 2, len(args))
+		}
+		s, err := argString("startsWith", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		prefix, err := argString("startsWith", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasPrefix(s, prefix), nil
+	}),
+	"endsWith": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("endsWith", 2, len(args))
+		}
+		s, err := argString("endsWith", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		suffix, err := argString("endsWith", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return strings.HasSuffix(s, suffix), nil
+	}),
+	"toLower": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("toLower", 1, len(args))
+		}
+		s, err := argString("toLower", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return strings.ToLower(s), nil
+	}),
+	"toUpper": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("toUpper", 1, len(args))
+		}
+		s, err := argString("toUpper", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return strings.ToUpper(s), nil
+	}),
+	"replace": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, arityError("replace", 3, len(args))
+		}
+		s, err := argString("replace", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		old, err := argString("replace", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		new, err := argString("replace", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return strings.ReplaceAll(s, old, new), nil
+	}),
+	"split": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("split", 2, len(args))
+		}
+		s, err := argString("split", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		sep, err := argString("split", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(s, sep), nil
+	}),
+	"len": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("len", 1, len(args))
+		}
+		s, err := argString("len", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return int64(len(s)), nil
+	}),
+
+	// math functions
+	"abs": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("abs", 1, len(args))
+		}
+		n, err := argFloat("abs", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return math.Abs(n), nil
+	}),
+	"min": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("min", 2, len(args))
+		}
+		a, err := argFloat("min", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := argFloat("min", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return math.Min(a, b), nil
+	}),
+	"max": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("max", 2, len(args))
+		}
+		a, err := argFloat("max", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := argFloat("max", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return math.Max(a, b), nil
+	}),
+	"pow": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("pow", 2, len(args))
+		}
+		a, err := argFloat("pow", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		b, err := argFloat("pow", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return math.Pow(a, b), nil
+	}),
+	"log": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("log", 1, len(args))
+		}
+		n, err := argFloat("log", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return math.Log(n), nil
+	}),
+	"exp": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("exp", 1, len(args))
+		}
+		n, err := argFloat("exp", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return math.Exp(n), nil
+	}),
+	"round": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("round", 1, len(args))
+		}
+		n, err := argFloat("round", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return math.Round(n), nil
+	}),
+	"ceil": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("ceil", 1, len(args))
+		}
+		n, err := argFloat("ceil", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return math.Ceil(n), nil
+	}),
+	"floor": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("floor", 1, len(args))
+		}
+		n, err := argFloat("floor", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return math.Floor(n), nil
+	}),
+	"clamp": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, arityError("clamp", 3, len(args))
+		}
+		n, err := argFloat("clamp", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		lo, err := argFloat("clamp", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := argFloat("clamp", args, 2)
+		if err != nil {
+			return nil, err
+		}
+		return math.Min(math.Max(n, lo), hi), nil
+	}),
+
+	// time functions, all operating on unix timestamps (seconds, UTC)
+	"now": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 0 {
+			return nil, arityError("now", 0, len(args))
+		}
+		return time.Now().Unix(), nil
+	}),
+	"unix": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("unix", 1, len(args))
+		}
+		d, ok := args[0].(time.Duration)
+		if !ok {
+			return nil, fmt.Errorf("unix argument 0 must be a duration, got %T", args[0])
+		}
+		return int64(d / time.Second), nil
+	}),
+	"hour": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("hour", 1, len(args))
+		}
+		ts, err := argInt("hour", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return int64(time.Unix(ts, 0).UTC().Hour()), nil
+	}),
+	"minute": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("minute", 1, len(args))
+		}
+		ts, err := argInt("minute", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return int64(time.Unix(ts, 0).UTC().Minute()), nil
+	}),
+	"weekday": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, arityError("weekday", 1, len(args))
+		}
+		ts, err := argInt("weekday", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return time.Unix(ts, 0).UTC().Weekday().String(), nil
+	}),
+
+	// regex functions
+	"match": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("match", 2, len(args))
+		}
+		rx, ok := args[0].(*regexp.Regexp)
+		if !ok {
+			return nil, fmt.Errorf("match argument 0 must be a regex, got %T", args[0])
+		}
+		s, err := argString("match", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return rx.MatchString(s), nil
+	}),
+	"capture": statelessFunc(func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, arityError("capture", 2, len(args))
+		}
+		rx, ok := args[0].(*regexp.Regexp)
+		if !ok {
+			return nil, fmt.Errorf("capture argument 0 must be a regex, got %T", args[0])
+		}
+		s, err := argString("capture", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		m := rx.FindStringSubmatch(s)
+		if len(m) < 2 {
+			return "", nil
+		}
+		return m[1], nil
+	}),
+}
+
+var builtinFuncSignatures = map[string]FuncSignature{
+	"contains":   {ArgTypes: []Type{StringType, StringType}, ReturnType: BoolType},
+	"startsWith": {ArgTypes: []Type{StringType, StringType}, ReturnType: BoolType},
+	"endsWith":   {ArgTypes: []Type{StringType, StringType}, ReturnType: BoolType},
+	"toLower":    {ArgTypes: []Type{StringType}, ReturnType: StringType},
+	"toUpper":    {ArgTypes: []Type{StringType}, ReturnType: StringType},
+	"replace":    {ArgTypes: []Type{StringType, StringType, StringType}, ReturnType: StringType},
+	"split":      {ArgTypes: []Type{StringType, StringType}, ReturnType: StringSliceType},
+	"len":        {ArgTypes: []Type{StringType}, ReturnType: Int64Type},
+	"abs":        {ArgTypes: []Type{Float64Type}, ReturnType: Float64Type},
+	"min":        {ArgTypes: []Type{Float64Type, Float64Type}, ReturnType: Float64Type},
+	"max":        {ArgTypes: []Type{Float64Type, Float64Type}, ReturnType: Float64Type},
+	"pow":        {ArgTypes: []Type{Float64Type, Float64Type}, ReturnType: Float64Type},
+	"log":        {ArgTypes: []Type{Float64Type}, ReturnType: Float64Type},
+	"exp":        {ArgTypes: []Type{Float64Type}, ReturnType: Float64Type},
+	"round":      {ArgTypes: []Type{Float64Type}, ReturnType: Float64Type},
+	"ceil":       {ArgTypes: []Type{Float64Type}, ReturnType: Float64Type},
+	"floor":      {ArgTypes: []Type{Float64Type}, ReturnType: Float64Type},
+	"clamp":      {ArgTypes: []Type{Float64Type, Float64Type, Float64Type}, ReturnType: Float64Type},
+	"now":        {ArgTypes: nil, ReturnType: Int64Type},
+	"unix":       {ArgTypes: []Type{DurationType}, ReturnType: Int64Type},
+	"hour":       {ArgTypes: []Type{Int64Type}, ReturnType: Int64Type},
+	"minute":     {ArgTypes: []Type{Int64Type}, ReturnType: Int64Type},
+	"weekday":    {ArgTypes: []Type{Int64Type}, ReturnType: StringType},
+	"match":      {ArgTypes: []Type{RegexType, StringType}, ReturnType: BoolType},
+	"capture":    {ArgTypes: []Type{RegexType, StringType}, ReturnType: StringType},
+}
@@ -0,0 +1,110 @@
+package tick
+
+import (
+	"sync"
+	"testing"
+)
+
+// accumulator is a stateful Func that sums every argument it's ever been
+// called with, the kind of function RegisterFunc's factory requirement
+// exists to isolate between StatefulExprs.
+type accumulator struct{ sum int64 }
+
+func (a *accumulator) Call(args ...interface{}) (interface{}, error) {
+	a.sum += args[0].(int64)
+	return a.sum, nil
+}
+func (a *accumulator) Reset() { a.sum = 0 }
+
+func TestRegisterFuncIsolatesStateBetweenExprs(t *testing.T) {
+	RegisterFunc("testAccumulate", func() Func { return &accumulator{} }, FuncSignature{
+		ArgTypes:   []Type{Int64Type},
+		ReturnType: Int64Type,
+	})
+
+	n := &FunctionNode{Func: "testAccumulate", Args: []Node{num(5)}}
+	a := NewStatefulExpr(n)
+	b := NewStatefulExpr(n)
+
+	if _, err := a.EvalNum(Vars{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.EvalNum(Vars{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.EvalNum(Vars{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 5 {
+		t.Fatalf("a's two calls leaked into b: got %v, want 5 (b's own first call)", got)
+	}
+
+	a.Reset()
+	got, err = a.EvalNum(Vars{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 5 {
+		t.Fatalf("Reset on a should clear a's accumulator: got %v, want 5 (a's first call after Reset)", got)
+	}
+}
+
+func TestRegisterFuncConcurrentWithNewFunctions(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			RegisterFunc("concurrentFunc", func() Func { return &accumulator{} }, FuncSignature{})
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = NewFunctions()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBuiltinStringFuncs(t *testing.T) {
+	cases := []struct {
+		name string
+		args []interface{}
+		want interface{}
+	}{
+		{"contains", []interface{}{"hello world", "world"}, true},
+		{"startsWith", []interface{}{"hello", "he"}, true},
+		{"endsWith", []interface{}{"hello", "lo"}, true},
+		{"toUpper", []interface{}{"abc"}, "ABC"},
+		{"toLower", []interface{}{"ABC"}, "abc"},
+		{"len", []interface{}{"abcd"}, int64(4)},
+	}
+	fns := NewFunctions()
+	for _, c := range cases {
+		got, err := fns[c.name].Call(c.args...)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestBuiltinArityError(t *testing.T) {
+	fns := NewFunctions()
+	if _, err := fns["abs"].Call(1.0, 2.0); err == nil {
+		t.Fatal("expected an arity error for abs(1, 2)")
+	}
+}
+
+func TestBuiltinMathFuncs(t *testing.T) {
+	fns := NewFunctions()
+	got, err := fns["clamp"].Call(5.0, 0.0, 3.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 3.0 {
+		t.Fatalf("clamp(5, 0, 3): got %v, want 3", got)
+	}
+}
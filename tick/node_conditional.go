@@ -0,0 +1,30 @@
+package tick
+
+// ConditionalNode represents a ternary/if-then-else conditional expression,
+// e.g. `cond ? trueExpr : falseExpr`. Only the branch selected by CondExpr
+// is evaluated.
+type ConditionalNode struct {
+	CondExpr  Node
+	TrueExpr  Node
+	FalseExpr Node
+}
+
+// tokenQuestion and tokenColon are the '?' and ':' tokens the ternary form
+// needs from the lexer.
+//
+// NOTE: this checkout does not include lexer.go/parser.go (the scanner's
+// rune-to-token switch and the precedence-climbing parser that builds
+// BinaryNode/UnaryNode from tokens), so these constants aren't wired into
+// an actual scan loop or parse rule yet. Until that file is updated to
+// recognize '?'/':' and emit a ConditionalNode, `cond ? a : b` cannot be
+// written in a .tick script yet -- ConditionalNode is only reachable by
+// constructing the AST directly (e.g. from Go code or tests) until the
+// lexer/parser change lands.
+//
+// Re-confirmed on review: this repo's history has never included a
+// lexer.go/parser.go, so the scanner/parser wiring for '?'/':' is still
+// outstanding, not merely missing from this series' diff.
+const (
+	tokenQuestion tokenType = iota + 1000
+	tokenColon
+)
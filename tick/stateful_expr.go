@@ -9,12 +9,25 @@ import (
 
 var ErrInvalidExpr = errors.New("expression is invalid, could not evaluate")
 
+// Null represents a missing field: a *ReferenceNode whose name isn't
+// present in the Vars passed to eval. In non-strict mode it propagates
+// through math operators (result Null) and comparisons (result false)
+// instead of raising ErrMismatchedTypes, so one absent field doesn't fail
+// an entire point.
+type Null struct{}
+
 // Expression functions are stateful. Their state is updated with
 // each call to the function. A StatefulExpr is a Node
 // and its associated function state.
 type StatefulExpr struct {
 	Node  Node
 	Funcs Funcs
+
+	// Strict disables int/float auto-coercion in math operators and Null
+	// propagation, restoring the original behavior of erroring via
+	// ErrMismatchedTypes whenever math operand types don't match exactly.
+	// Comparisons between int64 and float64 are allowed either way.
+	Strict bool
 }
 
 func NewStatefulExpr(n Node) *StatefulExpr {
@@ -24,6 +37,15 @@ func NewStatefulExpr(n Node) *StatefulExpr {
 	}
 }
 
+// NewStatefulExprStrict returns a StatefulExpr that errors on mixed
+// int64/float64 math operands and on missing fields, rather than coercing or
+// propagating Null.
+func NewStatefulExprStrict(n Node) *StatefulExpr {
+	s := NewStatefulExpr(n)
+	s.Strict = true
+	return s
+}
+
 // Reset the state
 func (s *StatefulExpr) Reset() {
 	for _, f := range s.Funcs {
@@ -43,8 +65,18 @@ func (s *StatefulExpr) EvalBool(v Vars) (bool, error) {
 	if stck.Len() == 1 {
 		value := stck.Pop()
 		// Resolve reference
+		var refName string
 		if ref, ok := value.(*ReferenceNode); ok {
-			value = v[ref.Reference]
+			refName = ref.Reference
+			value = resolveRef(ref, v)
+		}
+		if _, isNull := value.(Null); isNull {
+			if s.Strict {
+				return false, fmt.Errorf("undefined variable %s", refName)
+			}
+			// A missing field used as the whole expression behaves
+			// like a false comparison, same as nullResult.
+			return false, nil
 		}
 		b, ok := value.(bool)
 		if ok {
@@ -65,13 +97,23 @@ func (s *StatefulExpr) EvalNum(v Vars) (float64, error) {
 	if stck.Len() == 1 {
 		value := stck.Pop()
 		// Resolve reference
+		var refName string
 		if ref, ok := value.(*ReferenceNode); ok {
-			value = v[ref.Reference]
+			refName = ref.Reference
+			value = resolveRef(ref, v)
 		}
-		n, ok := value.(float64)
-		if ok {
+		if _, isNull := value.(Null); isNull {
+			if s.Strict {
+				return math.NaN(), fmt.Errorf("undefined variable %s", refName)
+			}
+			return math.NaN(), nil
+		}
+		switch n := value.(type) {
+		case float64:
 			return n, nil
-		} else {
+		case int64:
+			return float64(n), nil
+		default:
 			return math.NaN(), fmt.Errorf("expression returned unexpected type %T", value)
 		}
 	}
@@ -113,6 +155,34 @@ func (s *StatefulExpr) eval(n Node, v Vars, stck *stack) (err error) {
 		if err != nil {
 			return
 		}
+	case *ConditionalNode:
+		err = s.eval(node.CondExpr, v, stck)
+		if err != nil {
+			return
+		}
+		cond := stck.Pop()
+		// Resolve reference
+		if ref, ok := cond.(*ReferenceNode); ok {
+			cond = resolveRef(ref, v)
+		}
+		if _, isNull := cond.(Null); isNull {
+			if s.Strict {
+				return fmt.Errorf("invalid conditional expression: condition is undefined")
+			}
+			cond = false
+		}
+		b, ok := cond.(bool)
+		if !ok {
+			return fmt.Errorf("invalid conditional expression: condition must evaluate to bool but got %T", cond)
+		}
+		if b {
+			err = s.eval(node.TrueExpr, v, stck)
+		} else {
+			err = s.eval(node.FalseExpr, v, stck)
+		}
+		if err != nil {
+			return
+		}
 	case *FunctionNode:
 		args := make([]interface{}, len(node.Args))
 		for i, arg := range node.Args {
@@ -169,41 +239,93 @@ func (s *StatefulExpr) evalUnary(op tokenType, vars Vars, stck *stack) error {
 
 var ErrMismatchedTypes = errors.New("operands of binary operators must be of the same type, use bool(), int() and float() as needed")
 
+// nullResult is the value a binary operator produces when one of its
+// operands is Null in non-strict mode: math stays Null, comparisons are
+// simply false.
+func nullResult(op tokenType) interface{} {
+	if isCompOperator(op) {
+		return false
+	}
+	return Null{}
+}
+
+// resolveRef resolves a *ReferenceNode against vars, yielding Null when the
+// field is absent instead of the zero value of interface{} so callers can
+// tell "missing" apart from "present but nil".
+func resolveRef(ref *ReferenceNode, vars Vars) interface{} {
+	if v, ok := vars[ref.Reference]; ok {
+		return v
+	}
+	return Null{}
+}
+
 func (s *StatefulExpr) evalBinary(op tokenType, vars Vars, stck *stack) (err error) {
 	r := stck.Pop()
 	l := stck.Pop()
 	// Resolve any references
 	if ref, ok := l.(*ReferenceNode); ok {
-		l = vars[ref.Reference]
+		l = resolveRef(ref, vars)
 	}
 	if ref, ok := r.(*ReferenceNode); ok {
-		r = vars[ref.Reference]
+		r = resolveRef(ref, vars)
+	}
+	v, err := evalBinaryValues(op, l, r, s.Strict)
+	if err != nil {
+		return
+	}
+	stck.Push(v)
+	return
+}
+
+// evalBinaryValues applies a binary operator to already-resolved operand
+// values. It contains the type-dispatch rules shared by the tree-walking
+// evalBinary and the bytecode OpBinary instruction. In non-strict mode it
+// promotes mixed int64/float64 math to float64 and propagates Null operands
+// instead of erroring.
+func evalBinaryValues(op tokenType, l, r interface{}, strict bool) (v interface{}, err error) {
+	if !strict {
+		if _, ok := l.(Null); ok {
+			return nullResult(op), nil
+		}
+		if _, ok := r.(Null); ok {
+			return nullResult(op), nil
+		}
+		if isMathOperator(op) {
+			if ln, ok := l.(int64); ok {
+				if _, ok := r.(float64); ok {
+					l = float64(ln)
+				}
+			} else if rn, ok := r.(int64); ok {
+				if _, ok := l.(float64); ok {
+					r = float64(rn)
+				}
+			}
+		}
 	}
-	var v interface{}
 	switch {
 	case isMathOperator(op):
 		switch ln := l.(type) {
 		case int64:
 			rn, ok := r.(int64)
 			if !ok {
-				return ErrMismatchedTypes
+				return nil, ErrMismatchedTypes
 			}
 			v, err = doIntMath(op, ln, rn)
 		case float64:
 			rn, ok := r.(float64)
 			if !ok {
-				return ErrMismatchedTypes
+				return nil, ErrMismatchedTypes
 			}
 			v, err = doFloatMath(op, ln, rn)
 		default:
-			return ErrMismatchedTypes
+			return nil, ErrMismatchedTypes
 		}
 	case isCompOperator(op):
 		switch ln := l.(type) {
 		case bool:
 			rn, ok := r.(bool)
 			if !ok {
-				return ErrMismatchedTypes
+				return nil, ErrMismatchedTypes
 			}
 			v, err = doBoolComp(op, ln, rn)
 		case int64:
@@ -215,7 +337,7 @@ func (s *StatefulExpr) evalBinary(op tokenType, vars Vars, stck *stack) (err err
 			case float64:
 				rf = rn
 			default:
-				return ErrMismatchedTypes
+				return nil, ErrMismatchedTypes
 			}
 			v, err = doFloatComp(op, lf, rf)
 		case float64:
@@ -226,7 +348,7 @@ func (s *StatefulExpr) evalBinary(op tokenType, vars Vars, stck *stack) (err err
 			case float64:
 				rf = rn
 			default:
-				return ErrMismatchedTypes
+				return nil, ErrMismatchedTypes
 			}
 			v, err = doFloatComp(op, ln, rf)
 		case string:
@@ -236,21 +358,22 @@ func (s *StatefulExpr) evalBinary(op tokenType, vars Vars, stck *stack) (err err
 			} else if rx, ok := r.(*regexp.Regexp); ok {
 				v, err = doRegexComp(op, ln, rx)
 			} else {
-				return ErrMismatchedTypes
+				return nil, ErrMismatchedTypes
 			}
 		default:
-			return ErrMismatchedTypes
+			return nil, ErrMismatchedTypes
 		}
 	default:
-		return fmt.Errorf("return: unknown operator %v", op)
+		return nil, fmt.Errorf("return: unknown operator %v", op)
 	}
-	if err != nil {
-		return
-	}
-	stck.Push(v)
 	return
 }
 
+// ErrBitwiseOnFloat is returned when a bitwise or shift operator is applied
+// to float64 operands. Bitwise ops only make sense on integers; use int()
+// to convert first.
+var ErrBitwiseOnFloat = errors.New("bitwise and shift operators require int64 operands, use int() as needed")
+
 func doIntMath(op tokenType, l, r int64) (v int64, err error) {
 	switch op {
 	case tokenPlus:
@@ -261,6 +384,21 @@ func doIntMath(op tokenType, l, r int64) (v int64, err error) {
 		v = l * r
 	case tokenDiv:
 		v = l / r
+	case tokenMod:
+		if r == 0 {
+			return 0, errors.New("modulo by zero")
+		}
+		v = l % r
+	case tokenShiftLeft:
+		v = l << uint(r)
+	case tokenShiftRight:
+		v = l >> uint(r)
+	case tokenBitAnd:
+		v = l & r
+	case tokenBitOr:
+		v = l | r
+	case tokenBitXor:
+		v = l ^ r
 	default:
 		return 0, fmt.Errorf("invalid integer math operator %v", op)
 	}
@@ -277,6 +415,10 @@ func doFloatMath(op tokenType, l, r float64) (v float64, err error) {
 		v = l * r
 	case tokenDiv:
 		v = l / r
+	case tokenMod:
+		v = math.Mod(l, r)
+	case tokenShiftLeft, tokenShiftRight, tokenBitAnd, tokenBitOr, tokenBitXor:
+		return math.NaN(), ErrBitwiseOnFloat
 	default:
 		return math.NaN(), fmt.Errorf("invalid float math operator %v", op)
 	}
@@ -0,0 +1,163 @@
+package tick
+
+import (
+	"testing"
+)
+
+func num(i int64) *NumberNode    { return &NumberNode{IsInt: true, Int64: i} }
+func numF(f float64) *NumberNode { return &NumberNode{IsInt: false, Float64: f} }
+
+func TestStatefulExprConditional(t *testing.T) {
+	// severity = level == "crit" ? 3 : 1
+	n := &ConditionalNode{
+		CondExpr: &BinaryNode{
+			Operator: tokenEqual,
+			Left:     &ReferenceNode{Reference: "level"},
+			Right:    &StringNode{Literal: "crit"},
+		},
+		TrueExpr:  num(3),
+		FalseExpr: num(1),
+	}
+	se := NewStatefulExpr(n)
+
+	got, err := se.EvalNum(Vars{"level": "crit"})
+	if err != nil || got != 3 {
+		t.Fatalf("crit branch: got %v, %v, want 3, nil", got, err)
+	}
+
+	got, err = se.EvalNum(Vars{"level": "info"})
+	if err != nil || got != 1 {
+		t.Fatalf("non-crit branch: got %v, %v, want 1, nil", got, err)
+	}
+}
+
+// countingFunc is a stateful Func that counts how many times it's called,
+// used to assert that ConditionalNode only evaluates the chosen branch.
+type countingFunc struct{ calls int }
+
+func (f *countingFunc) Call(args ...interface{}) (interface{}, error) {
+	f.calls++
+	return args[0], nil
+}
+func (f *countingFunc) Reset() { f.calls = 0 }
+
+func TestStatefulExprConditionalShortCircuits(t *testing.T) {
+	trueCounter := &countingFunc{}
+	falseCounter := &countingFunc{}
+
+	n := &ConditionalNode{
+		CondExpr:  &BoolNode{Bool: true},
+		TrueExpr:  &FunctionNode{Func: "trueBranch", Args: []Node{num(1)}},
+		FalseExpr: &FunctionNode{Func: "falseBranch", Args: []Node{num(2)}},
+	}
+	se := NewStatefulExpr(n)
+	se.Funcs["trueBranch"] = trueCounter
+	se.Funcs["falseBranch"] = falseCounter
+
+	if _, err := se.EvalNum(Vars{}); err != nil {
+		t.Fatal(err)
+	}
+	if trueCounter.calls != 1 || falseCounter.calls != 0 {
+		t.Fatalf("expected only the true branch to run, got true=%d false=%d", trueCounter.calls, falseCounter.calls)
+	}
+}
+
+func TestStatefulExprConditionalNonBoolCond(t *testing.T) {
+	n := &ConditionalNode{CondExpr: num(1), TrueExpr: num(1), FalseExpr: num(2)}
+	_, err := NewStatefulExpr(n).EvalNum(Vars{})
+	if err == nil {
+		t.Fatal("expected an error for a non-bool condition")
+	}
+}
+
+func TestDoIntMathNewOperators(t *testing.T) {
+	cases := []struct {
+		op   tokenType
+		l, r int64
+		want int64
+	}{
+		{tokenMod, 7, 3, 1},
+		{tokenShiftLeft, 1, 4, 16},
+		{tokenShiftRight, 16, 4, 1},
+		{tokenBitAnd, 0x6, 0x3, 0x2},
+		{tokenBitOr, 0x4, 0x1, 0x5},
+		{tokenBitXor, 0x5, 0x1, 0x4},
+	}
+	for _, c := range cases {
+		got, err := doIntMath(c.op, c.l, c.r)
+		if err != nil {
+			t.Fatalf("op %v: unexpected error: %v", c.op, err)
+		}
+		if got != c.want {
+			t.Errorf("op %v: got %d, want %d", c.op, got, c.want)
+		}
+	}
+}
+
+func TestDoIntMathModByZero(t *testing.T) {
+	if _, err := doIntMath(tokenMod, 1, 0); err == nil {
+		t.Fatal("expected an error for modulo by zero")
+	}
+}
+
+func TestDoFloatMathModAndBitwise(t *testing.T) {
+	got, err := doFloatMath(tokenMod, 7.5, 2)
+	if err != nil || got != 1.5 {
+		t.Fatalf("7.5 %% 2: got %v, %v, want 1.5, nil", got, err)
+	}
+	if _, err := doFloatMath(tokenBitAnd, 1, 2); err != ErrBitwiseOnFloat {
+		t.Fatalf("expected ErrBitwiseOnFloat, got %v", err)
+	}
+}
+
+func TestEvalBinaryValuesCoercion(t *testing.T) {
+	v, err := evalBinaryValues(tokenPlus, int64(1), 2.5, false)
+	if err != nil || v != 3.5 {
+		t.Fatalf("non-strict int+float: got %v, %v, want 3.5, nil", v, err)
+	}
+	if _, err := evalBinaryValues(tokenPlus, int64(1), 2.5, true); err != ErrMismatchedTypes {
+		t.Fatalf("strict int+float: got %v, want ErrMismatchedTypes", err)
+	}
+}
+
+func TestEvalBinaryValuesNullPropagation(t *testing.T) {
+	v, err := evalBinaryValues(tokenPlus, Null{}, int64(1), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(Null); !ok {
+		t.Fatalf("math with Null: got %T, want Null", v)
+	}
+
+	v, err = evalBinaryValues(tokenEqual, Null{}, int64(1), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != false {
+		t.Fatalf("comparison with Null: got %v, want false", v)
+	}
+}
+
+func TestStatefulExprMissingFieldNonStrict(t *testing.T) {
+	n := &BinaryNode{Operator: tokenPlus, Left: &ReferenceNode{Reference: "missing"}, Right: num(1)}
+	se := NewStatefulExpr(n)
+	if _, err := se.EvalNum(Vars{}); err != nil {
+		t.Fatalf("non-strict missing field should not error, got %v", err)
+	}
+}
+
+func TestStatefulExprMissingFieldStrict(t *testing.T) {
+	n := &BinaryNode{Operator: tokenPlus, Left: &ReferenceNode{Reference: "missing"}, Right: num(1)}
+	se := NewStatefulExprStrict(n)
+	if _, err := se.EvalNum(Vars{}); err == nil {
+		t.Fatal("strict missing field should error")
+	}
+}
+
+func TestStatefulExprEvalBoolMissingFieldTopLevel(t *testing.T) {
+	n := &ReferenceNode{Reference: "missing"}
+	b, err := NewStatefulExpr(n).EvalBool(Vars{})
+	if err != nil || b != false {
+		t.Fatalf("got %v, %v, want false, nil", b, err)
+	}
+}
@@ -0,0 +1,23 @@
+package tick
+
+// Modulo, shift, and bitwise operator tokens used by doIntMath/doFloatMath.
+//
+// NOTE: like tokenQuestion/tokenColon in node_conditional.go, this checkout
+// doesn't include lexer.go (the scanner) or parser.go (the precedence
+// tables for the multiplicative group `* / % << >> &` and additive group
+// `+ - | ^`), so these tokens aren't reachable from tokenizing a .tick
+// script yet -- only from a BinaryNode built by hand. Scanning and
+// precedence wiring belongs in that file once it's available in this tree.
+//
+// Re-confirmed on review: this repo's history has never included a
+// lexer.go/parser.go, so `flags & 0x4`, `ts % 3600`, etc. are still
+// unusable from an actual .tick script, not merely missing from this
+// series' diff.
+const (
+	tokenMod tokenType = iota + 1100
+	tokenShiftLeft
+	tokenShiftRight
+	tokenBitAnd
+	tokenBitOr
+	tokenBitXor
+)
@@ -0,0 +1,297 @@
+package tick
+
+import (
+	"fmt"
+)
+
+// Type represents the static type of a tick expression node, as determined
+// by TypeCheck. It mirrors the runtime value kinds evalBinary already
+// switches on.
+type Type int
+
+const (
+	InvalidType Type = iota
+	BoolType
+	Int64Type
+	Float64Type
+	StringType
+	DurationType
+	RegexType
+	StringSliceType
+)
+
+func (t Type) String() string {
+	switch t {
+	case BoolType:
+		return "bool"
+	case Int64Type:
+		return "int64"
+	case Float64Type:
+		return "float64"
+	case StringType:
+		return "string"
+	case DurationType:
+		return "duration"
+	case RegexType:
+		return "regex"
+	case StringSliceType:
+		return "[]string"
+	default:
+		return "invalid"
+	}
+}
+
+// positioner is implemented by nodes that can report their position in the
+// original TICKscript source, so TypeCheck errors can point at them.
+type positioner interface {
+	Position() int
+}
+
+func position(n Node) string {
+	if p, ok := n.(positioner); ok {
+		return fmt.Sprintf(" at char %d", p.Position())
+	}
+	return ""
+}
+
+// TypeCheck validates operator and operand types across n, using schema to
+// resolve the type of any *ReferenceNode. It returns the type the
+// expression evaluates to, or a descriptive error the first time it finds
+// a type mismatch that would otherwise only surface from StatefulExpr.eval
+// once the offending point came through.
+//
+// strict must match the StatefulExpr that will evaluate n: in non-strict
+// mode (StatefulExpr's default, see evalBinaryValues) mixed int64/float64
+// math is allowed and promotes to Float64Type, the same coercion the
+// evaluator performs at runtime. Passing strict=true instead requires
+// exact operand types, matching NewStatefulExprStrict.
+func TypeCheck(n Node, schema map[string]Type, strict bool) (Type, error) {
+	switch node := n.(type) {
+	case *BoolNode:
+		return BoolType, nil
+	case *NumberNode:
+		if node.IsInt {
+			return Int64Type, nil
+		}
+		return Float64Type, nil
+	case *DurationNode:
+		return DurationType, nil
+	case *StringNode:
+		return StringType, nil
+	case *RegexNode:
+		return RegexType, nil
+	case *ReferenceNode:
+		t, ok := schema[node.Reference]
+		if !ok {
+			return InvalidType, fmt.Errorf("unknown reference %q%s", node.Reference, position(n))
+		}
+		return t, nil
+	case *UnaryNode:
+		t, err := TypeCheck(node.Node, schema, strict)
+		if err != nil {
+			return InvalidType, err
+		}
+		switch node.Operator {
+		case tokenMinus:
+			if t != Int64Type && t != Float64Type {
+				return InvalidType, fmt.Errorf("invalid argument to '-', expected int64 or float64, got %s%s", t, position(n))
+			}
+		case tokenNot:
+			if t != BoolType {
+				return InvalidType, fmt.Errorf("invalid argument to '!', expected bool, got %s%s", t, position(n))
+			}
+		}
+		return t, nil
+	case *BinaryNode:
+		return typeCheckBinary(node, schema, strict)
+	case *ConditionalNode:
+		ct, err := TypeCheck(node.CondExpr, schema, strict)
+		if err != nil {
+			return InvalidType, err
+		}
+		if ct != BoolType {
+			return InvalidType, fmt.Errorf("conditional expression must be bool, got %s%s", ct, position(node.CondExpr))
+		}
+		tt, err := TypeCheck(node.TrueExpr, schema, strict)
+		if err != nil {
+			return InvalidType, err
+		}
+		ft, err := TypeCheck(node.FalseExpr, schema, strict)
+		if err != nil {
+			return InvalidType, err
+		}
+		if tt != ft {
+			return InvalidType, fmt.Errorf("conditional branches have mismatched types %s and %s%s", tt, ft, position(n))
+		}
+		return tt, nil
+	case *FunctionNode:
+		argTypes := make([]Type, len(node.Args))
+		for i, arg := range node.Args {
+			t, err := TypeCheck(arg, schema, strict)
+			if err != nil {
+				return InvalidType, err
+			}
+			argTypes[i] = t
+		}
+		sig, ok := funcSignature(node.Func)
+		if !ok {
+			// Registered via RegisterFunc without a signature, or resolved
+			// only at eval time; fall back to checking it there.
+			return InvalidType, nil
+		}
+		if len(sig.ArgTypes) != len(argTypes) {
+			return InvalidType, fmt.Errorf("%s expects %d argument(s), got %d%s", node.Func, len(sig.ArgTypes), len(argTypes), position(n))
+		}
+		for i, want := range sig.ArgTypes {
+			if argTypes[i] != want && !(isNumeric(want) && isNumeric(argTypes[i])) {
+				return InvalidType, fmt.Errorf("%s argument %d must be %s, got %s%s", node.Func, i, want, argTypes[i], position(n))
+			}
+		}
+		return sig.ReturnType, nil
+	default:
+		return InvalidType, fmt.Errorf("cannot type check node of type %T%s", n, position(n))
+	}
+}
+
+func isNumeric(t Type) bool {
+	return t == Int64Type || t == Float64Type
+}
+
+// isBitwiseOperator reports whether op is one of the integer-only bitwise
+// or shift operators added alongside tokenMod (see token_math.go).
+// isMathOperator also returns true for these -- doIntMath/doFloatMath
+// still dispatch on it -- but unlike + - * / they require Int64Type on
+// both sides, mirroring doFloatMath's ErrBitwiseOnFloat.
+func isBitwiseOperator(op tokenType) bool {
+	switch op {
+	case tokenShiftLeft, tokenShiftRight, tokenBitAnd, tokenBitOr, tokenBitXor:
+		return true
+	}
+	return false
+}
+
+func typeCheckBinary(node *BinaryNode, schema map[string]Type, strict bool) (Type, error) {
+	lt, err := TypeCheck(node.Left, schema, strict)
+	if err != nil {
+		return InvalidType, err
+	}
+	rt, err := TypeCheck(node.Right, schema, strict)
+	if err != nil {
+		return InvalidType, err
+	}
+	switch {
+	case isBitwiseOperator(node.Operator):
+		if lt == Int64Type && rt == Int64Type {
+			return Int64Type, nil
+		}
+		return InvalidType, fmt.Errorf("mismatched types %s and %s for operator %v%s: %s", lt, rt, node.Operator, position(node), ErrBitwiseOnFloat)
+	case isMathOperator(node.Operator):
+		if lt == Int64Type && rt == Int64Type {
+			return Int64Type, nil
+		}
+		if lt == Float64Type && rt == Float64Type {
+			return Float64Type, nil
+		}
+		if !strict && isNumeric(lt) && isNumeric(rt) {
+			// Mirrors evalBinaryValues' non-strict int64/float64 promotion.
+			return Float64Type, nil
+		}
+		return InvalidType, fmt.Errorf("mismatched types %s and %s for operator %v%s: %s", lt, rt, node.Operator, position(node), ErrMismatchedTypes)
+	case isCompOperator(node.Operator):
+		switch {
+		case lt == BoolType && rt == BoolType,
+			lt == StringType && rt == StringType,
+			lt == StringType && rt == RegexType,
+			(lt == Int64Type || lt == Float64Type) && (rt == Int64Type || rt == Float64Type):
+			return BoolType, nil
+		default:
+			return InvalidType, fmt.Errorf("mismatched types %s and %s for operator %v%s: %s", lt, rt, node.Operator, position(node), ErrMismatchedTypes)
+		}
+	default:
+		return InvalidType, fmt.Errorf("unknown operator %v%s", node.Operator, position(node))
+	}
+}
+
+// Fold pre-computes purely-literal subtrees of n, such as constant math
+// (`60 * 60 * 24` becomes a single NumberNode) and constant conditionals,
+// so StatefulExpr.eval doesn't redo the same work on every point. Nodes
+// that reference a variable or call a function are left untouched since
+// their value isn't known until evaluation.
+func Fold(n Node) Node {
+	switch node := n.(type) {
+	case *UnaryNode:
+		node.Node = Fold(node.Node)
+		if folded, ok := foldUnary(node); ok {
+			return folded
+		}
+		return node
+	case *BinaryNode:
+		node.Left = Fold(node.Left)
+		node.Right = Fold(node.Right)
+		if folded, ok := foldBinary(node); ok {
+			return folded
+		}
+		return node
+	case *ConditionalNode:
+		node.CondExpr = Fold(node.CondExpr)
+		node.TrueExpr = Fold(node.TrueExpr)
+		node.FalseExpr = Fold(node.FalseExpr)
+		if b, ok := node.CondExpr.(*BoolNode); ok {
+			if b.Bool {
+				return node.TrueExpr
+			}
+			return node.FalseExpr
+		}
+		return node
+	case *FunctionNode:
+		for i, arg := range node.Args {
+			node.Args[i] = Fold(arg)
+		}
+		return node
+	default:
+		return n
+	}
+}
+
+func foldUnary(node *UnaryNode) (Node, bool) {
+	switch v := node.Node.(type) {
+	case *NumberNode:
+		switch node.Operator {
+		case tokenMinus:
+			if v.IsInt {
+				return &NumberNode{IsInt: true, Int64: -1 * v.Int64}, true
+			}
+			return &NumberNode{IsInt: false, Float64: -1 * v.Float64}, true
+		}
+	case *BoolNode:
+		if node.Operator == tokenNot {
+			return &BoolNode{Bool: !v.Bool}, true
+		}
+	}
+	return nil, false
+}
+
+func foldBinary(node *BinaryNode) (Node, bool) {
+	l, lok := node.Left.(*NumberNode)
+	r, rok := node.Right.(*NumberNode)
+	if !lok || !rok || l.IsInt != r.IsInt {
+		return nil, false
+	}
+	var v interface{}
+	var err error
+	if l.IsInt {
+		v, err = doIntMath(node.Operator, l.Int64, r.Int64)
+	} else {
+		v, err = doFloatMath(node.Operator, l.Float64, r.Float64)
+	}
+	if err != nil {
+		return nil, false
+	}
+	switch n := v.(type) {
+	case int64:
+		return &NumberNode{IsInt: true, Int64: n}, true
+	case float64:
+		return &NumberNode{IsInt: false, Float64: n}, true
+	}
+	return nil, false
+}
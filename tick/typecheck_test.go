@@ -0,0 +1,135 @@
+package tick
+
+import (
+	"testing"
+)
+
+func TestTypeCheckBinaryStrictVsLenient(t *testing.T) {
+	n := &BinaryNode{Operator: tokenPlus, Left: &ReferenceNode{Reference: "value"}, Right: num(1)}
+	schema := map[string]Type{"value": Float64Type}
+
+	typ, err := TypeCheck(n, schema, false)
+	if err != nil {
+		t.Fatalf("lenient: unexpected error: %v", err)
+	}
+	if typ != Float64Type {
+		t.Fatalf("lenient: got %v, want Float64Type", typ)
+	}
+
+	if _, err := TypeCheck(n, schema, true); err == nil {
+		t.Fatal("strict: expected ErrMismatchedTypes for int64 + float64")
+	}
+}
+
+func TestTypeCheckBitwiseRequiresInt64(t *testing.T) {
+	n := &BinaryNode{Operator: tokenBitAnd, Left: &ReferenceNode{Reference: "flags"}, Right: numF(4)}
+	schema := map[string]Type{"flags": Float64Type}
+
+	// Non-strict numeric promotion must NOT apply here: doFloatMath
+	// rejects bitwise/shift operators outright (ErrBitwiseOnFloat), so
+	// TypeCheck has to reject them too, not just for strict callers.
+	if _, err := TypeCheck(n, schema, false); err == nil {
+		t.Fatal("expected an error for flags & 4.0, float64 operands aren't valid for bitwise ops")
+	}
+
+	schema["flags"] = Int64Type
+	n.Right = num(4)
+	typ, err := TypeCheck(n, schema, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != Int64Type {
+		t.Fatalf("got %v, want Int64Type", typ)
+	}
+}
+
+func TestTypeCheckConditional(t *testing.T) {
+	n := &ConditionalNode{
+		CondExpr:  &BinaryNode{Operator: tokenEqual, Left: &ReferenceNode{Reference: "level"}, Right: &StringNode{Literal: "crit"}},
+		TrueExpr:  num(3),
+		FalseExpr: num(1),
+	}
+	schema := map[string]Type{"level": StringType}
+	typ, err := TypeCheck(n, schema, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != Int64Type {
+		t.Fatalf("got %v, want Int64Type", typ)
+	}
+}
+
+func TestTypeCheckConditionalMismatchedBranches(t *testing.T) {
+	n := &ConditionalNode{CondExpr: &BoolNode{Bool: true}, TrueExpr: num(1), FalseExpr: &StringNode{Literal: "x"}}
+	if _, err := TypeCheck(n, nil, false); err == nil {
+		t.Fatal("expected an error for mismatched branch types")
+	}
+}
+
+func TestTypeCheckFunctionReturnTypeSplit(t *testing.T) {
+	n := &FunctionNode{Func: "split", Args: []Node{&StringNode{Literal: "a,b"}, &StringNode{Literal: ","}}}
+	typ, err := TypeCheck(n, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != StringSliceType {
+		t.Fatalf("got %v, want StringSliceType", typ)
+	}
+}
+
+func TestTypeCheckFunctionArity(t *testing.T) {
+	n := &FunctionNode{Func: "abs", Args: []Node{num(1), num(2)}}
+	if _, err := TypeCheck(n, nil, false); err == nil {
+		t.Fatal("expected an arity error for abs(1, 2)")
+	}
+}
+
+func TestTypeCheckFunctionReturnType(t *testing.T) {
+	n := &FunctionNode{Func: "contains", Args: []Node{&StringNode{Literal: "abc"}, &StringNode{Literal: "b"}}}
+	typ, err := TypeCheck(n, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != BoolType {
+		t.Fatalf("got %v, want BoolType", typ)
+	}
+}
+
+func TestFoldConstantMath(t *testing.T) {
+	// 60 * 60 * 24
+	n := &BinaryNode{
+		Operator: tokenMult,
+		Left: &BinaryNode{
+			Operator: tokenMult,
+			Left:     num(60),
+			Right:    num(60),
+		},
+		Right: num(24),
+	}
+	folded := Fold(n)
+	got, ok := folded.(*NumberNode)
+	if !ok || !got.IsInt || got.Int64 != 86400 {
+		t.Fatalf("got %#v, want NumberNode{IsInt: true, Int64: 86400}", folded)
+	}
+}
+
+func TestFoldConstantConditional(t *testing.T) {
+	n := &ConditionalNode{CondExpr: &BoolNode{Bool: true}, TrueExpr: num(1), FalseExpr: num(2)}
+	folded := Fold(n)
+	got, ok := folded.(*NumberNode)
+	if !ok || got.Int64 != 1 {
+		t.Fatalf("got %#v, want NumberNode{Int64: 1}", folded)
+	}
+}
+
+func TestFoldLeavesReferencesAlone(t *testing.T) {
+	n := &BinaryNode{Operator: tokenPlus, Left: &ReferenceNode{Reference: "x"}, Right: num(1)}
+	folded := Fold(n)
+	bn, ok := folded.(*BinaryNode)
+	if !ok {
+		t.Fatalf("got %#v, want *BinaryNode unchanged", folded)
+	}
+	if _, ok := bn.Left.(*ReferenceNode); !ok {
+		t.Fatalf("left operand should remain a reference, got %#v", bn.Left)
+	}
+}